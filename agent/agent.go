@@ -0,0 +1,75 @@
+package agent
+
+import (
+	"sync"
+
+	"github.com/hashicorp/consul/agent/config"
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// Agent is the long-running process that registers services and checks
+// with the local Consul client and keeps them in sync with the catalog.
+// Only the subset needed to register and deregister Connect sidecar
+// proxies is implemented; there is no anti-entropy sync, RPC, DNS or HTTP
+// endpoint in this package.
+type Agent struct {
+	config *config.RuntimeConfig
+
+	// sidecarPortAllocator assigns and reclaims auto-generated sidecar
+	// proxy ports. Defaults to the sequential allocator; tests may swap it
+	// for the bitmap-backed one.
+	sidecarPortAllocator SidecarPortAllocator
+
+	stateLock sync.RWMutex
+	State     *localState
+}
+
+// localState is the agent's in-memory catalog of registered services.
+type localState struct {
+	services map[string]*structs.NodeService
+}
+
+// Services returns a snapshot of the currently registered services, keyed
+// by service ID.
+func (s *localState) Services() map[string]*structs.NodeService {
+	out := make(map[string]*structs.NodeService, len(s.services))
+	for id, svc := range s.services {
+		out[id] = svc
+	}
+	return out
+}
+
+// NewAgent builds an Agent from a resolved RuntimeConfig, defaulting to the
+// sequential sidecar port allocator.
+func NewAgent(cfg *config.RuntimeConfig) *Agent {
+	a := &Agent{
+		config: cfg,
+		State:  &localState{services: make(map[string]*structs.NodeService)},
+	}
+	a.sidecarPortAllocator = newSequentialPortAllocator(a)
+	return a
+}
+
+// AddService registers ns in the agent's local state. chkTypes, persist and
+// token are accepted but not recorded.
+func (a *Agent) AddService(ns *structs.NodeService, chkTypes []*structs.CheckType, persist bool, token string) error {
+	a.stateLock.Lock()
+	defer a.stateLock.Unlock()
+	a.State.services[ns.ID] = ns
+	return nil
+}
+
+// RemoveService deregisters serviceID. A Connect sidecar proxy releases its
+// auto-assigned port back to the configured SidecarPortAllocator so it can
+// be handed to a future sidecar.
+func (a *Agent) RemoveService(serviceID string) error {
+	a.stateLock.Lock()
+	svc, ok := a.State.services[serviceID]
+	delete(a.State.services, serviceID)
+	a.stateLock.Unlock()
+
+	if ok && svc.Kind == structs.ServiceKindConnectProxy {
+		a.releaseSidecarServicePort(serviceID)
+	}
+	return nil
+}
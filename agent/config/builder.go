@@ -0,0 +1,25 @@
+package config
+
+// Build resolves a raw Config into a RuntimeConfig, applying each pointer
+// field only when explicitly set.
+func Build(c Config) *RuntimeConfig {
+	rt := &RuntimeConfig{}
+	if c.NodeName != nil {
+		rt.NodeName = *c.NodeName
+	}
+	if c.Datacenter != nil {
+		rt.Datacenter = *c.Datacenter
+	}
+	if c.Ports != nil {
+		if c.Ports.SidecarMinPort != nil {
+			rt.SidecarMinPort = *c.Ports.SidecarMinPort
+		}
+		if c.Ports.SidecarMaxPort != nil {
+			rt.SidecarMaxPort = *c.Ports.SidecarMaxPort
+		}
+	}
+	if c.Connect != nil && c.Connect.SidecarAutoStatsTags != nil {
+		rt.ConnectSidecarAutoStatsTags = *c.Connect.SidecarAutoStatsTags
+	}
+	return rt
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuild_ConnectSidecarAutoStatsTags(t *testing.T) {
+	enabled := true
+	c := Config{
+		Connect: &ConnectConfig{
+			SidecarAutoStatsTags: &enabled,
+		},
+	}
+
+	require.True(t, Build(c).ConnectSidecarAutoStatsTags)
+}
+
+func TestBuild_ConnectSidecarAutoStatsTagsDefaultsFalse(t *testing.T) {
+	require.False(t, Build(Config{}).ConnectSidecarAutoStatsTags)
+}
@@ -0,0 +1,19 @@
+package config
+
+// Config is the raw, pre-merge agent configuration as parsed directly from
+// a JSON or HCL config file. Pointer fields let the builder distinguish
+// "unset" from "explicitly zero" while layering multiple config sources.
+type Config struct {
+	NodeName   *string        `json:"node_name,omitempty" hcl:"node_name" mapstructure:"node_name"`
+	Datacenter *string        `json:"datacenter,omitempty" hcl:"datacenter" mapstructure:"datacenter"`
+	Ports      *PortsConfig   `json:"ports,omitempty" hcl:"ports" mapstructure:"ports"`
+	Connect    *ConnectConfig `json:"connect,omitempty" hcl:"connect" mapstructure:"connect"`
+}
+
+// PortsConfig configures the port ranges the agent auto-assigns from.
+type PortsConfig struct {
+	// SidecarMinPort and SidecarMaxPort bound the range Connect sidecar
+	// proxies get their ports auto-assigned from.
+	SidecarMinPort *int `json:"sidecar_min_port,omitempty" hcl:"sidecar_min_port" mapstructure:"sidecar_min_port"`
+	SidecarMaxPort *int `json:"sidecar_max_port,omitempty" hcl:"sidecar_max_port" mapstructure:"sidecar_max_port"`
+}
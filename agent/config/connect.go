@@ -0,0 +1,13 @@
+package config
+
+// ConnectConfig is the raw `connect { ... }` stanza of the agent's own
+// configuration (as opposed to a service's connect stanza, see
+// ServiceConnect).
+type ConnectConfig struct {
+	// SidecarAutoStatsTags, when true, makes the agent merge node/service/
+	// datacenter identity tags into every auto-generated sidecar's
+	// Proxy.Config, so xDS/Envoy stats can be broken down by them without
+	// every operator hand-authoring envoy_stats_tags. See
+	// RuntimeConfig.ConnectSidecarAutoStatsTags.
+	SidecarAutoStatsTags *bool `json:"sidecar_auto_stats_tags,omitempty" hcl:"sidecar_auto_stats_tags" mapstructure:"sidecar_auto_stats_tags"`
+}
@@ -0,0 +1,13 @@
+package config
+
+import "github.com/hashicorp/hcl"
+
+// Parse decodes an HCL (or JSON, which HCL accepts as a subset) config
+// source into a raw Config, ready for Build.
+func Parse(data string) (Config, error) {
+	var c Config
+	if err := hcl.Decode(&c, data); err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
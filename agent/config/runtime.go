@@ -0,0 +1,19 @@
+package config
+
+// RuntimeConfig is the agent's fully-resolved configuration, after merging
+// defaults, config files and command-line flags. Only the subset consumed
+// by the Connect sidecar subsystem is represented here.
+type RuntimeConfig struct {
+	NodeName   string
+	Datacenter string
+
+	// SidecarMinPort and SidecarMaxPort bound the range the agent
+	// auto-assigns sidecar proxy ports from.
+	SidecarMinPort int
+	SidecarMaxPort int
+
+	// ConnectSidecarAutoStatsTags mirrors connect.sidecar_auto_stats_tags:
+	// when true, auto-generated sidecars get node/service/datacenter
+	// identity tags merged into their Proxy.Config.
+	ConnectSidecarAutoStatsTags bool
+}
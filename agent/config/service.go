@@ -0,0 +1,63 @@
+package config
+
+import "github.com/hashicorp/consul/agent/structs"
+
+// ServiceDefinition is the raw, pre-merge representation of a service
+// registration as read from a `service { ... }` stanza or a service
+// snippet file. Pointer fields distinguish "not set in this source" from
+// "explicitly set to the zero value" while config sources are merged.
+type ServiceDefinition struct {
+	Kind  *string `json:"kind,omitempty" hcl:"kind" mapstructure:"kind"`
+	ID    *string `json:"id,omitempty" hcl:"id" mapstructure:"id"`
+	Name  *string `json:"name,omitempty" hcl:"name" mapstructure:"name"`
+	Port  *int    `json:"port,omitempty" hcl:"port" mapstructure:"port"`
+	Token *string `json:"token,omitempty" hcl:"token" mapstructure:"token"`
+
+	// DisableDefaultTCPCheck suppresses the 127.0.0.1:<port> TCP check the
+	// agent would otherwise synthesize for a sidecar proxy, e.g. because
+	// it's bound to a Unix socket or a non-loopback address instead.
+	DisableDefaultTCPCheck *bool `json:"disable_default_tcp_check,omitempty" hcl:"disable_default_tcp_check" mapstructure:"disable_default_tcp_check"`
+
+	Connect *ServiceConnect `json:"connect,omitempty" hcl:"connect" mapstructure:"connect"`
+}
+
+// ServiceConnect is the raw `connect { ... }` stanza of a service
+// registration.
+type ServiceConnect struct {
+	SidecarService *ServiceDefinition `json:"sidecar_service,omitempty" hcl:"sidecar_service" mapstructure:"sidecar_service"`
+}
+
+// translateServiceDefinition converts a raw, pointer-typed ServiceDefinition
+// parsed from a config file into the structs.ServiceDefinition the agent
+// registers, applying each field only when explicitly set.
+func translateServiceDefinition(raw *ServiceDefinition) *structs.ServiceDefinition {
+	if raw == nil {
+		return nil
+	}
+
+	out := &structs.ServiceDefinition{}
+	if raw.Kind != nil {
+		out.Kind = structs.ServiceKind(*raw.Kind)
+	}
+	if raw.ID != nil {
+		out.ID = *raw.ID
+	}
+	if raw.Name != nil {
+		out.Name = *raw.Name
+	}
+	if raw.Port != nil {
+		out.Port = *raw.Port
+	}
+	if raw.Token != nil {
+		out.Token = *raw.Token
+	}
+	if raw.DisableDefaultTCPCheck != nil {
+		out.DisableDefaultTCPCheck = *raw.DisableDefaultTCPCheck
+	}
+	if raw.Connect != nil {
+		out.Connect = &structs.ServiceConnect{
+			SidecarService: translateServiceDefinition(raw.Connect.SidecarService),
+		}
+	}
+	return out
+}
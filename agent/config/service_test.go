@@ -0,0 +1,36 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateServiceDefinition_DisableDefaultTCPCheck(t *testing.T) {
+	raw := `{
+		"name": "web",
+		"port": 1111,
+		"connect": {
+			"sidecar_service": {
+				"disable_default_tcp_check": true
+			}
+		}
+	}`
+
+	var sd ServiceDefinition
+	require.NoError(t, json.Unmarshal([]byte(raw), &sd))
+
+	got := translateServiceDefinition(&sd)
+	require.True(t, got.Connect.SidecarService.DisableDefaultTCPCheck)
+}
+
+func TestTranslateServiceDefinition_DisableDefaultTCPCheckDefaultsFalse(t *testing.T) {
+	raw := `{"name": "web", "port": 1111}`
+
+	var sd ServiceDefinition
+	require.NoError(t, json.Unmarshal([]byte(raw), &sd))
+
+	got := translateServiceDefinition(&sd)
+	require.False(t, got.DisableDefaultTCPCheck)
+}
@@ -0,0 +1,186 @@
+package agent
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SidecarPortAllocator assigns and reclaims the auto-generated ports used by
+// Connect sidecar proxies. Implementations must be safe for concurrent use.
+// It's exposed on Agent so tests (and, eventually, alternate deployment
+// strategies) can swap in a different allocation policy.
+type SidecarPortAllocator interface {
+	// Allocate returns a free port for the given sidecar service ID, or an
+	// error if the configured range has been exhausted. A sidecar that
+	// already holds a port (because it's already registered, or because it
+	// previously held one and hasn't been Released) gets that same port
+	// back.
+	Allocate(sidecarServiceID string) (int, error)
+
+	// Release returns a sidecar's allocated port to the pool, e.g. once it
+	// has been deregistered. Releasing a sidecar that holds no port is a
+	// no-op.
+	Release(sidecarServiceID string)
+
+	// Reserve marks a specific port as held by sidecarServiceID without
+	// going through Allocate, e.g. when the port was set explicitly by the
+	// operator rather than auto-assigned.
+	Reserve(sidecarServiceID string, port int) error
+}
+
+// sequentialPortAllocator is the original allocation strategy: a linear scan
+// of [minPort, maxPort] against the agent's currently registered services.
+// It keeps no state of its own between calls, so Release and Reserve are
+// no-ops and a re-registered sidecar is only guaranteed to get its previous
+// port back for as long as that registration is still present in agent
+// state.
+type sequentialPortAllocator struct {
+	agent *Agent
+}
+
+func newSequentialPortAllocator(a *Agent) *sequentialPortAllocator {
+	return &sequentialPortAllocator{agent: a}
+}
+
+func (p *sequentialPortAllocator) Allocate(sidecarServiceID string) (int, error) {
+	cfg := p.agent.config
+	minPort := cfg.SidecarMinPort
+	maxPort := cfg.SidecarMaxPort
+
+	if minPort == 0 && maxPort == 0 {
+		return 0, fmt.Errorf("auto-assignement disabled in config")
+	}
+	if minPort > maxPort {
+		return 0, fmt.Errorf("sidecar_min_port must be less than or equal to sidecar_max_port")
+	}
+
+	p.agent.stateLock.Lock()
+	defer p.agent.stateLock.Unlock()
+
+	used := make(map[int]bool)
+	for _, svc := range p.agent.State.Services() {
+		if svc.ID == sidecarServiceID {
+			return svc.Port, nil
+		}
+		if svc.Port >= minPort && svc.Port <= maxPort {
+			used[svc.Port] = true
+		}
+	}
+	for port := minPort; port <= maxPort; port++ {
+		if !used[port] {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("none left in the configured range [%d, %d]", minPort, maxPort)
+}
+
+func (p *sequentialPortAllocator) Release(sidecarServiceID string) {
+	// Nothing to do: ports are derived from live agent state on every call.
+}
+
+func (p *sequentialPortAllocator) Reserve(sidecarServiceID string, port int) error {
+	// Nothing to reserve ahead of time; Allocate already treats an existing
+	// registration for sidecarServiceID as implicitly held.
+	return nil
+}
+
+// bitmapPortAllocator tracks port usage in a bitmap over [minPort, maxPort]
+// and remembers the last port handed out to each service ID, so a sidecar
+// that deregisters and re-registers gets its previous port back if it's
+// still free ("sticky" reservations). Unlike sequentialPortAllocator it does
+// not consult agent state, so it must be kept in sync via Release.
+type bitmapPortAllocator struct {
+	minPort, maxPort int
+
+	mu           sync.Mutex
+	used         []bool         // index 0 corresponds to minPort
+	reservations map[string]int // sidecarServiceID -> held port
+}
+
+func newBitmapPortAllocator(minPort, maxPort int) *bitmapPortAllocator {
+	size := 0
+	if maxPort >= minPort {
+		size = maxPort - minPort + 1
+	}
+	return &bitmapPortAllocator{
+		minPort:      minPort,
+		maxPort:      maxPort,
+		used:         make([]bool, size),
+		reservations: make(map[string]int),
+	}
+}
+
+func (p *bitmapPortAllocator) Allocate(sidecarServiceID string) (int, error) {
+	if p.minPort == 0 && p.maxPort == 0 {
+		return 0, fmt.Errorf("auto-assignement disabled in config")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// A remembered port is either still held by this ID or free again after
+	// a Release: claiming a port drops any other ID's reservation for it, so
+	// nobody else can have been handed it since. Hand it back rather than
+	// treating re-registration as a fresh allocation.
+	if port, ok := p.reservations[sidecarServiceID]; ok {
+		p.used[port-p.minPort] = true
+		return port, nil
+	}
+
+	for i, inUse := range p.used {
+		if !inUse {
+			port := p.minPort + i
+			for id, held := range p.reservations {
+				if held == port {
+					delete(p.reservations, id)
+				}
+			}
+			p.used[i] = true
+			p.reservations[sidecarServiceID] = port
+			return port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("none left in the configured range [%d, %d], held reservations: %v",
+		p.minPort, p.maxPort, p.reservations)
+}
+
+func (p *bitmapPortAllocator) Release(sidecarServiceID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	port, ok := p.reservations[sidecarServiceID]
+	if !ok {
+		return
+	}
+	p.used[port-p.minPort] = false
+}
+
+func (p *bitmapPortAllocator) Reserve(sidecarServiceID string, port int) error {
+	if port < p.minPort || port > p.maxPort {
+		return fmt.Errorf("port %d is outside the configured range [%d, %d]", port, p.minPort, p.maxPort)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Re-reserving the port this ID already holds, or held before a Release,
+	// succeeds and marks it held again - a plain re-register must not fail.
+	if held, ok := p.reservations[sidecarServiceID]; ok && held == port {
+		p.used[port-p.minPort] = true
+		return nil
+	}
+
+	idx := port - p.minPort
+	if p.used[idx] {
+		return fmt.Errorf("port %d is already reserved", port)
+	}
+	for id, held := range p.reservations {
+		if held == port {
+			delete(p.reservations, id)
+		}
+	}
+	p.used[idx] = true
+	p.reservations[sidecarServiceID] = port
+	return nil
+}
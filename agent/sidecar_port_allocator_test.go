@@ -0,0 +1,36 @@
+package agent
+
+import "testing"
+
+func TestBitmapPortAllocator_AllocateIdempotentOnReRegister(t *testing.T) {
+	p := newBitmapPortAllocator(2222, 2223)
+
+	port, err := p.Allocate("web1-sidecar-proxy")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A plain re-register, with no Release in between, must get the same
+	// port back rather than leaking it and handing out a second one.
+	again, err := p.Allocate("web1-sidecar-proxy")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if again != port {
+		t.Fatalf("expected re-registration to keep port %d, got %d", port, again)
+	}
+}
+
+func TestBitmapPortAllocator_ReserveIdempotentOnReRegister(t *testing.T) {
+	p := newBitmapPortAllocator(2222, 2223)
+
+	if err := p.Reserve("web1-sidecar-proxy", 2222); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Re-reserving the same port for the same ID, with no Release in
+	// between, must succeed rather than hard-failing as "already reserved".
+	if err := p.Reserve("web1-sidecar-proxy", 2222); err != nil {
+		t.Fatalf("unexpected error on re-reserve: %v", err)
+	}
+}
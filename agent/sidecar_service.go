@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// sidecarServiceFromNodeService returns the auto-generated sidecar proxy
+// NodeServices and their parallel CheckTypes for the given NodeService's
+// Connect sidecar(s), plus the ACL token to register them with (which may be
+// a sidecar's own override token, falling back to the token passed in). If
+// the service has no sidecar configured, it returns nil slices, an empty
+// token and a nil error.
+//
+// A service may configure either a single, unnamed sidecar via
+// Connect.SidecarService, or one or more named upstreams-only sidecars via
+// Connect.SidecarServices - never both. Each named entry gets its own
+// auto-allocated port, its own "<parent-id>-sidecar-proxy-<name>" ID and its
+// own alias check, so that e.g. a DB-upstreams proxy and a cache-upstreams
+// proxy for the same service don't have to be registered by hand.
+func (a *Agent) sidecarServiceFromNodeService(ns *structs.NodeService, token string) ([]*structs.NodeService, [][]*structs.CheckType, string, error) {
+	defs, err := sidecarDefinitionsFor(ns.Connect)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if len(defs) == 0 {
+		return nil, nil, "", nil
+	}
+
+	sidecars := make([]*structs.NodeService, 0, len(defs))
+	checkSets := make([][]*structs.CheckType, 0, len(defs))
+	proxyToken := token
+
+	// Sidecars generated earlier in this same call aren't registered via
+	// AddService until the caller does so afterwards, but a stateless
+	// allocator like sequentialPortAllocator only sees ports as "used" once
+	// they show up in agent state. Provisionally register each sidecar as
+	// soon as it's built so its sibling doesn't get handed the same port,
+	// then roll the provisional entries back before returning - the caller
+	// is still responsible for the real registration.
+	var provisional []string
+	defer func() {
+		a.stateLock.Lock()
+		for _, id := range provisional {
+			delete(a.State.services, id)
+		}
+		a.stateLock.Unlock()
+	}()
+
+	for _, d := range defs {
+		sidecar, checks, err := a.sidecarServiceFromDefinition(ns, d.idSuffix, d.def)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		sidecars = append(sidecars, sidecar)
+		checkSets = append(checkSets, checks)
+
+		a.stateLock.Lock()
+		a.State.services[sidecar.ID] = sidecar
+		a.stateLock.Unlock()
+		provisional = append(provisional, sidecar.ID)
+
+		// The legacy single-sidecar token override only makes sense when
+		// there's exactly one sidecar to register it against.
+		if len(defs) == 1 && d.def.Token != "" {
+			proxyToken = d.def.Token
+		}
+	}
+
+	return sidecars, checkSets, proxyToken, nil
+}
+
+// sidecarDefinition pairs a sidecar's ServiceDefinition with the suffix used
+// to derive its ID from the parent service's ID.
+type sidecarDefinition struct {
+	idSuffix string
+	def      *structs.ServiceDefinition
+}
+
+// sidecarDefinitionsFor normalizes the legacy single SidecarService and the
+// newer named SidecarServices map into an ordered list of sidecars to
+// generate. Named entries are sorted by name for deterministic ID and port
+// assignment across registrations. It's an error to set both SidecarService
+// and SidecarServices on the same Connect config.
+func sidecarDefinitionsFor(connect *structs.ServiceConnect) ([]sidecarDefinition, error) {
+	if connect == nil {
+		return nil, nil
+	}
+	if connect.SidecarService != nil && len(connect.SidecarServices) > 0 {
+		return nil, fmt.Errorf("a service may configure either Connect.SidecarService or Connect.SidecarServices, not both")
+	}
+	if connect.SidecarService != nil {
+		return []sidecarDefinition{{idSuffix: "-sidecar-proxy", def: connect.SidecarService}}, nil
+	}
+	if len(connect.SidecarServices) == 0 {
+		return nil, nil
+	}
+
+	names := make([]string, 0, len(connect.SidecarServices))
+	for name := range connect.SidecarServices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]sidecarDefinition, 0, len(names))
+	for _, name := range names {
+		defs = append(defs, sidecarDefinition{
+			idSuffix: fmt.Sprintf("-sidecar-proxy-%s", name),
+			def:      connect.SidecarServices[name],
+		})
+	}
+	return defs, nil
+}
+
+// sidecarServiceFromDefinition builds a single sidecar proxy NodeService and
+// its CheckTypes from one entry returned by sidecarDefinitionsFor.
+func (a *Agent) sidecarServiceFromDefinition(ns *structs.NodeService, idSuffix string, def *structs.ServiceDefinition) (*structs.NodeService, []*structs.CheckType, error) {
+	sidecar := def.NodeService()
+
+	// Inherit ID, Kind and Service name from the parent service unless
+	// explicitly overridden.
+	sidecar.ID = ns.ID + idSuffix
+	sidecar.Kind = structs.ServiceKindConnectProxy
+	if sidecar.Service == "" {
+		sidecar.Service = ns.Service + "-sidecar-proxy"
+	}
+
+	// Reject operator-supplied reserved Meta keys before we allocate a port
+	// or inject our own "consul-sidecar" bookkeeping key below.
+	if err := sidecar.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if sidecar.Port < 1 {
+		port, err := a.sidecarPortAllocator.Allocate(sidecar.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		sidecar.Port = port
+	} else if err := a.sidecarPortAllocator.Reserve(sidecar.ID, sidecar.Port); err != nil {
+		// An operator-chosen port still has to be marked held so a later
+		// auto-assigned sidecar can't be handed the same one.
+		return nil, nil, err
+	}
+
+	// Fill in the proxy defaults from the parent service.
+	if sidecar.Proxy.DestinationServiceName == "" {
+		sidecar.Proxy.DestinationServiceName = ns.Service
+	}
+	if sidecar.Proxy.DestinationServiceID == "" {
+		sidecar.Proxy.DestinationServiceID = ns.ID
+	}
+	if sidecar.Proxy.LocalServiceAddress == "" {
+		sidecar.Proxy.LocalServiceAddress = "127.0.0.1"
+	}
+	if sidecar.Proxy.LocalServicePort < 1 {
+		sidecar.Proxy.LocalServicePort = ns.Port
+	}
+
+	if sidecar.Meta == nil {
+		sidecar.Meta = make(map[string]string)
+	}
+	sidecar.Meta["consul-sidecar"] = "y"
+
+	if a.config.ConnectSidecarAutoStatsTags {
+		if sidecar.Proxy.Config == nil {
+			sidecar.Proxy.Config = make(map[string]interface{})
+		}
+		for k, v := range a.sidecarStatsTags(ns) {
+			if _, ok := sidecar.Proxy.Config[k]; !ok {
+				sidecar.Proxy.Config[k] = v
+			}
+		}
+	}
+
+	// Set up checks. If the user specified their own, honor them as-is and
+	// skip all the defaults below.
+	checks, err := def.CheckTypes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(checks) == 0 {
+		if !def.DisableDefaultTCPCheck {
+			checks = append(checks, &structs.CheckType{
+				Name:     "Connect Sidecar Listening",
+				TCP:      fmt.Sprintf("127.0.0.1:%d", sidecar.Port),
+				Interval: 10 * time.Second,
+			})
+		}
+		// The alias check against the parent service always fires regardless
+		// of whether the synthesized TCP check was suppressed above; it's
+		// what actually reflects the sidecar's health in the parent's UI.
+		checks = append(checks, &structs.CheckType{
+			Name:         fmt.Sprintf("Connect Sidecar Aliasing %s", ns.ID),
+			AliasService: ns.ID,
+		})
+	}
+
+	return sidecar, checks, nil
+}
+
+// releaseSidecarServicePort returns a deregistered sidecar's auto-assigned
+// port to the agent's SidecarPortAllocator. Called from RemoveService for
+// any service of kind ServiceKindConnectProxy so the port can be reused by a
+// future sidecar.
+func (a *Agent) releaseSidecarServicePort(serviceID string) {
+	a.sidecarPortAllocator.Release(serviceID)
+}
+
+// sidecarStatsTags returns the well-known identity tags that get merged into
+// an auto-injected sidecar's Proxy.Config when connect.sidecar_auto_stats_tags
+// is enabled, so that xDS/Envoy stats can be broken down by node, service and
+// datacenter without every operator hand-authoring envoy_stats_tags.
+func (a *Agent) sidecarStatsTags(ns *structs.NodeService) map[string]interface{} {
+	tags := map[string]interface{}{
+		"node_name":    a.config.NodeName,
+		"service_id":   ns.ID,
+		"service_name": ns.Service,
+		"datacenter":   a.config.Datacenter,
+	}
+	if allocID := os.Getenv("NOMAD_ALLOC_ID"); allocID != "" {
+		tags["alloc_id"] = allocID
+	}
+	return tags
+}
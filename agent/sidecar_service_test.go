@@ -15,8 +15,9 @@ func TestAgent_sidecarServiceFromNodeService(t *testing.T) {
 		sd                *structs.ServiceDefinition
 		token             string
 		autoPortsDisabled bool
-		wantNS            *structs.NodeService
-		wantChecks        []*structs.CheckType
+		autoStatsTags     bool
+		wantSidecars      []*structs.NodeService
+		wantChecks        [][]*structs.CheckType
 		wantToken         string
 		wantErr           string
 	}{
@@ -26,11 +27,11 @@ func TestAgent_sidecarServiceFromNodeService(t *testing.T) {
 				Name: "web",
 				Port: 1111,
 			},
-			token:      "foo",
-			wantNS:     nil,
-			wantChecks: nil,
-			wantToken:  "",
-			wantErr:    "", // Should NOT error
+			token:        "foo",
+			wantSidecars: nil,
+			wantChecks:   nil,
+			wantToken:    "",
+			wantErr:      "", // Should NOT error
 		},
 		{
 			name: "all the defaults",
@@ -43,28 +44,32 @@ func TestAgent_sidecarServiceFromNodeService(t *testing.T) {
 				},
 			},
 			token: "foo",
-			wantNS: &structs.NodeService{
-				Kind:    structs.ServiceKindConnectProxy,
-				ID:      "web1-sidecar-proxy",
-				Service: "web-sidecar-proxy",
-				Port:    2222,
-				Meta:    map[string]string{"consul-sidecar": "y"},
-				Proxy: structs.ConnectProxyConfig{
-					DestinationServiceName: "web",
-					DestinationServiceID:   "web1",
-					LocalServiceAddress:    "127.0.0.1",
-					LocalServicePort:       1111,
-				},
-			},
-			wantChecks: []*structs.CheckType{
-				&structs.CheckType{
-					Name:     "Connect Sidecar Listening",
-					TCP:      "127.0.0.1:2222",
-					Interval: 10 * time.Second,
-				},
-				&structs.CheckType{
-					Name:         "Connect Sidecar Aliasing web1",
-					AliasService: "web1",
+			wantSidecars: []*structs.NodeService{
+				{
+					Kind:    structs.ServiceKindConnectProxy,
+					ID:      "web1-sidecar-proxy",
+					Service: "web-sidecar-proxy",
+					Port:    2222,
+					Meta:    map[string]string{"consul-sidecar": "y"},
+					Proxy: structs.ConnectProxyConfig{
+						DestinationServiceName: "web",
+						DestinationServiceID:   "web1",
+						LocalServiceAddress:    "127.0.0.1",
+						LocalServicePort:       1111,
+					},
+				},
+			},
+			wantChecks: [][]*structs.CheckType{
+				{
+					&structs.CheckType{
+						Name:     "Connect Sidecar Listening",
+						TCP:      "127.0.0.1:2222",
+						Interval: 10 * time.Second,
+					},
+					&structs.CheckType{
+						Name:         "Connect Sidecar Aliasing web1",
+						AliasService: "web1",
+					},
 				},
 			},
 			wantToken: "foo",
@@ -100,35 +105,206 @@ func TestAgent_sidecarServiceFromNodeService(t *testing.T) {
 				},
 			},
 			token: "foo",
-			wantNS: &structs.NodeService{
-				Kind:    structs.ServiceKindConnectProxy,
-				ID:      "web1-sidecar-proxy",
-				Service: "motorbike1",
-				Port:    3333,
-				Tags:    []string{"foo", "bar"},
-				Address: "127.127.127.127",
-				Meta: map[string]string{
-					"foo":            "bar",
-					"consul-sidecar": "y",
-				},
-				EnableTagOverride: true,
-				Proxy: structs.ConnectProxyConfig{
-					DestinationServiceName: "web",
-					DestinationServiceID:   "web1",
-					LocalServiceAddress:    "127.0.127.0",
-					LocalServicePort:       9999,
-					Config:                 map[string]interface{}{"baz": "qux"},
-					Upstreams:              structs.TestAddDefaultsToUpstreams(t, structs.TestUpstreams(t)),
-				},
-			},
-			wantChecks: []*structs.CheckType{
-				&structs.CheckType{
-					ScriptArgs: []string{"sleep", "1"},
-					Interval:   999 * time.Second,
+			wantSidecars: []*structs.NodeService{
+				{
+					Kind:    structs.ServiceKindConnectProxy,
+					ID:      "web1-sidecar-proxy",
+					Service: "motorbike1",
+					Port:    3333,
+					Tags:    []string{"foo", "bar"},
+					Address: "127.127.127.127",
+					Meta: map[string]string{
+						"foo":            "bar",
+						"consul-sidecar": "y",
+					},
+					EnableTagOverride: true,
+					Proxy: structs.ConnectProxyConfig{
+						DestinationServiceName: "web",
+						DestinationServiceID:   "web1",
+						LocalServiceAddress:    "127.0.127.0",
+						LocalServicePort:       9999,
+						Config:                 map[string]interface{}{"baz": "qux"},
+						Upstreams:              structs.TestAddDefaultsToUpstreams(t, structs.TestUpstreams(t)),
+					},
+				},
+			},
+			wantChecks: [][]*structs.CheckType{
+				{
+					&structs.CheckType{
+						ScriptArgs: []string{"sleep", "1"},
+						Interval:   999 * time.Second,
+					},
 				},
 			},
 			wantToken: "custom-token",
 		},
+		{
+			name: "disable default tcp check",
+			sd: &structs.ServiceDefinition{
+				ID:   "web1",
+				Name: "web",
+				Port: 1111,
+				Connect: &structs.ServiceConnect{
+					SidecarService: &structs.ServiceDefinition{
+						DisableDefaultTCPCheck: true,
+					},
+				},
+			},
+			token: "foo",
+			wantSidecars: []*structs.NodeService{
+				{
+					Kind:    structs.ServiceKindConnectProxy,
+					ID:      "web1-sidecar-proxy",
+					Service: "web-sidecar-proxy",
+					Port:    2222,
+					Meta:    map[string]string{"consul-sidecar": "y"},
+					Proxy: structs.ConnectProxyConfig{
+						DestinationServiceName: "web",
+						DestinationServiceID:   "web1",
+						LocalServiceAddress:    "127.0.0.1",
+						LocalServicePort:       1111,
+					},
+				},
+			},
+			wantChecks: [][]*structs.CheckType{
+				{
+					&structs.CheckType{
+						Name:         "Connect Sidecar Aliasing web1",
+						AliasService: "web1",
+					},
+				},
+			},
+			wantToken: "foo",
+		},
+		{
+			name:          "auto stats tags",
+			autoStatsTags: true,
+			sd: &structs.ServiceDefinition{
+				ID:   "web1",
+				Name: "web",
+				Port: 1111,
+				Connect: &structs.ServiceConnect{
+					SidecarService: &structs.ServiceDefinition{
+						Proxy: &structs.ConnectProxyConfig{
+							Config: map[string]interface{}{
+								"service_name": "overridden",
+							},
+						},
+					},
+				},
+			},
+			token: "foo",
+			wantSidecars: []*structs.NodeService{
+				{
+					Kind:    structs.ServiceKindConnectProxy,
+					ID:      "web1-sidecar-proxy",
+					Service: "web-sidecar-proxy",
+					Port:    2222,
+					Meta:    map[string]string{"consul-sidecar": "y"},
+					Proxy: structs.ConnectProxyConfig{
+						DestinationServiceName: "web",
+						DestinationServiceID:   "web1",
+						LocalServiceAddress:    "127.0.0.1",
+						LocalServicePort:       1111,
+						Config: map[string]interface{}{
+							"node_name":    "jones",
+							"service_id":   "web1",
+							"service_name": "overridden",
+							"datacenter":   "dc1",
+						},
+					},
+				},
+			},
+			wantChecks: [][]*structs.CheckType{
+				{
+					&structs.CheckType{
+						Name:     "Connect Sidecar Listening",
+						TCP:      "127.0.0.1:2222",
+						Interval: 10 * time.Second,
+					},
+					&structs.CheckType{
+						Name:         "Connect Sidecar Aliasing web1",
+						AliasService: "web1",
+					},
+				},
+			},
+			wantToken: "foo",
+		},
+		{
+			name: "multiple named sidecars",
+			sd: &structs.ServiceDefinition{
+				ID:   "web1",
+				Name: "web",
+				Port: 1111,
+				Connect: &structs.ServiceConnect{
+					SidecarServices: map[string]*structs.ServiceDefinition{
+						"db": {
+							Proxy: &structs.ConnectProxyConfig{
+								Upstreams: structs.Upstreams{
+									{DestinationType: "service", DestinationName: "db", LocalBindPort: 6000},
+								},
+							},
+						},
+						"cache": {
+							Proxy: &structs.ConnectProxyConfig{
+								Upstreams: structs.Upstreams{
+									{DestinationType: "service", DestinationName: "cache", LocalBindPort: 6001},
+								},
+							},
+						},
+					},
+				},
+			},
+			token: "foo",
+			// sidecar_min_port/max_port only has room for one port in this test's
+			// default HCL, so this case configures its own wider range below and
+			// is asserted structurally rather than via wantSidecars/wantChecks.
+			wantErr: "",
+		},
+		{
+			name: "sidecar_service and sidecar_services are mutually exclusive",
+			sd: &structs.ServiceDefinition{
+				ID:   "web1",
+				Name: "web",
+				Port: 1111,
+				Connect: &structs.ServiceConnect{
+					SidecarService: &structs.ServiceDefinition{},
+					SidecarServices: map[string]*structs.ServiceDefinition{
+						"db": {},
+					},
+				},
+			},
+			token:   "foo",
+			wantErr: "either Connect.SidecarService or Connect.SidecarServices, not both",
+		},
+		{
+			name: "multiple named sidecars validate independently",
+			sd: &structs.ServiceDefinition{
+				ID:   "web1",
+				Name: "web",
+				Port: 1111,
+				Connect: &structs.ServiceConnect{
+					SidecarServices: map[string]*structs.ServiceDefinition{
+						"cache": {
+							Proxy: &structs.ConnectProxyConfig{
+								Upstreams: structs.Upstreams{
+									{DestinationType: "service", DestinationName: "cache", LocalBindPort: 6001},
+								},
+							},
+						},
+						"db": {
+							Check: structs.CheckType{
+								TCP: "foo",
+								// Invalid since no interval specified - must not be
+								// masked by the sibling "cache" entry validating fine.
+							},
+						},
+					},
+				},
+			},
+			token:   "foo",
+			wantErr: "Interval must be > 0",
+		},
 		{
 			name: "no auto ports available",
 			// register another sidecar consuming our 1 and only allocated auto port.
@@ -211,6 +387,14 @@ func TestAgent_sidecarServiceFromNodeService(t *testing.T) {
 				sidecar_max_port = 2222
 			}
 			`
+			if tt.name == "multiple named sidecars" || tt.name == "multiple named sidecars validate independently" {
+				hcl = `
+				ports {
+					sidecar_min_port = 2222
+					sidecar_max_port = 2223
+				}
+				`
+			}
 			if tt.autoPortsDisabled {
 				hcl = `
 				ports {
@@ -219,6 +403,13 @@ func TestAgent_sidecarServiceFromNodeService(t *testing.T) {
 				}
 				`
 			}
+			if tt.autoStatsTags {
+				hcl += `
+				connect {
+					sidecar_auto_stats_tags = true
+				}
+				`
+			}
 
 			require := require.New(t)
 			a := NewTestAgent("jones", hcl)
@@ -232,17 +423,76 @@ func TestAgent_sidecarServiceFromNodeService(t *testing.T) {
 			err := ns.Validate()
 			require.NoError(err, "Invalid test case - NodeService must validate")
 
-			gotNS, gotChecks, gotToken, err := a.sidecarServiceFromNodeService(ns, tt.token)
+			gotSidecars, gotChecks, gotToken, err := a.sidecarServiceFromNodeService(ns, tt.token)
 			if tt.wantErr != "" {
 				require.Error(err)
 				require.Contains(err.Error(), tt.wantErr)
 				return
 			}
-
 			require.NoError(err)
-			require.Equal(tt.wantNS, gotNS)
+
+			if tt.name == "multiple named sidecars" {
+				require.Len(gotSidecars, 2)
+				require.Len(gotChecks, 2)
+
+				byID := make(map[string]*structs.NodeService, len(gotSidecars))
+				for _, s := range gotSidecars {
+					byID[s.ID] = s
+				}
+
+				db, ok := byID["web1-sidecar-proxy-db"]
+				require.True(ok, "expected a sidecar for the db upstream group")
+				cache, ok := byID["web1-sidecar-proxy-cache"]
+				require.True(ok, "expected a sidecar for the cache upstream group")
+
+				require.NotEqual(db.Port, cache.Port, "each named sidecar must get its own port")
+				require.Equal(structs.ServiceKindConnectProxy, db.Kind)
+				require.Equal(structs.ServiceKindConnectProxy, cache.Kind)
+				return
+			}
+
+			require.Equal(tt.wantSidecars, gotSidecars)
 			require.Equal(tt.wantChecks, gotChecks)
 			require.Equal(tt.wantToken, gotToken)
 		})
 	}
 }
+
+func TestAgent_sidecarServiceFromNodeService_bitmapPortReuse(t *testing.T) {
+	require := require.New(t)
+	hcl := `
+	ports {
+		sidecar_min_port = 2222
+		sidecar_max_port = 2223
+	}
+	`
+	a := NewTestAgent("jones", hcl)
+	a.sidecarPortAllocator = newBitmapPortAllocator(2222, 2223)
+
+	sd := &structs.ServiceDefinition{
+		ID:   "web1",
+		Name: "web",
+		Port: 1111,
+		Connect: &structs.ServiceConnect{
+			SidecarService: &structs.ServiceDefinition{},
+		},
+	}
+	ns := sd.NodeService()
+	require.NoError(ns.Validate())
+
+	sidecars, checks, token, err := a.sidecarServiceFromNodeService(ns, "foo")
+	require.NoError(err)
+	require.Len(sidecars, 1)
+	require.Equal(2222, sidecars[0].Port)
+	require.NoError(a.AddService(sidecars[0], checks[0], false, token))
+
+	// Deregister the sidecar through the real agent path and re-register
+	// the parent: it should get the same port back rather than the next
+	// free one.
+	require.NoError(a.RemoveService(sidecars[0].ID))
+
+	sidecars2, _, _, err := a.sidecarServiceFromNodeService(ns, "foo")
+	require.NoError(err)
+	require.Len(sidecars2, 1)
+	require.Equal(2222, sidecars2[0].Port)
+}
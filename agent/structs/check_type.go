@@ -0,0 +1,42 @@
+package structs
+
+import (
+	"fmt"
+	"time"
+)
+
+// CheckType represents a single check to register against a service,
+// whether synthesized by the agent (e.g. a sidecar's liveness check) or
+// supplied by the operator.
+type CheckType struct {
+	CheckID      string        `json:",omitempty"`
+	Name         string        `json:",omitempty"`
+	ScriptArgs   []string      `json:",omitempty"`
+	HTTP         string        `json:",omitempty"`
+	TCP          string        `json:",omitempty"`
+	Interval     time.Duration `json:",omitempty"`
+	AliasService string        `json:",omitempty"`
+}
+
+// CheckTypes is a list of CheckType.
+type CheckTypes []*CheckType
+
+// Empty reports whether c carries no check definition at all, i.e. a
+// ServiceDefinition.Check zero value that should be skipped rather than
+// registered.
+func (c *CheckType) Empty() bool {
+	return c.ScriptArgs == nil && c.HTTP == "" && c.TCP == "" && c.AliasService == "" && c.Interval == 0
+}
+
+// Validate returns an error if c defines a check (script/HTTP/TCP) without
+// the interval required to run it. Alias checks have no interval of their
+// own, so they're exempt.
+func (c *CheckType) Validate() error {
+	if c.AliasService != "" {
+		return nil
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("Interval must be > 0")
+	}
+	return nil
+}
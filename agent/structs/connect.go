@@ -0,0 +1,18 @@
+package structs
+
+// ServiceConnect describes the Connect configuration for a registered
+// service: whether it's natively integrated, and/or what sidecar proxy
+// the agent should generate for it.
+type ServiceConnect struct {
+	// Native is true if this service can natively understand Connect.
+	Native bool `json:",omitempty"`
+
+	// SidecarService, if set, is a service definition template the agent
+	// uses to auto-generate a single sidecar proxy for this service.
+	SidecarService *ServiceDefinition `json:",omitempty"`
+
+	// SidecarServices configures one or more named, upstreams-only sidecar
+	// proxies for this service, e.g. separate proxies for distinct groups
+	// of upstreams. Mutually exclusive with SidecarService.
+	SidecarServices map[string]*ServiceDefinition `json:"sidecar_services,omitempty"`
+}
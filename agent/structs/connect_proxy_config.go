@@ -0,0 +1,54 @@
+package structs
+
+// Upstream destination types recognized by ConnectProxyConfig.Upstreams.
+const (
+	UpstreamDestTypeService       = "service"
+	UpstreamDestTypePreparedQuery = "prepared_query"
+)
+
+// Upstream describes a single upstream a Connect proxy should dial on
+// behalf of the service it fronts.
+type Upstream struct {
+	DestinationType      string `json:",omitempty"`
+	DestinationNamespace string `json:",omitempty"`
+	DestinationName      string
+	Datacenter           string                 `json:",omitempty"`
+	LocalBindAddress     string                 `json:",omitempty"`
+	LocalBindPort        int                    `json:",omitempty"`
+	Config               map[string]interface{} `json:",omitempty"`
+}
+
+// Upstreams is a list of upstream configurations for a Connect proxy.
+type Upstreams []Upstream
+
+// addUpstreamDefaults fills in the defaults Consul applies to every
+// upstream: DestinationType defaults to "service" and LocalBindAddress
+// defaults to loopback.
+func addUpstreamDefaults(us Upstreams) Upstreams {
+	if len(us) == 0 {
+		return us
+	}
+	out := make(Upstreams, len(us))
+	for i, u := range us {
+		if u.DestinationType == "" {
+			u.DestinationType = UpstreamDestTypeService
+		}
+		if u.LocalBindAddress == "" {
+			u.LocalBindAddress = "127.0.0.1"
+		}
+		out[i] = u
+	}
+	return out
+}
+
+// ConnectProxyConfig is the subset of a Connect proxy's configuration that
+// the agent fills in for auto-generated sidecar proxies, and that's
+// accepted as-is for hand-registered ones.
+type ConnectProxyConfig struct {
+	DestinationServiceName string
+	DestinationServiceID   string                 `json:",omitempty"`
+	LocalServiceAddress    string                 `json:",omitempty"`
+	LocalServicePort       int                    `json:",omitempty"`
+	Config                 map[string]interface{} `json:",omitempty"`
+	Upstreams              Upstreams              `json:",omitempty"`
+}
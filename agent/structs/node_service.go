@@ -0,0 +1,37 @@
+package structs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// metaKeyReservedPrefix marks metadata keys the agent generates for its own
+// bookkeeping (e.g. consul-sidecar); operators can't set keys under it.
+const metaKeyReservedPrefix = "consul-"
+
+// NodeService represents a service instance registered against a node,
+// including the Connect configuration that drives sidecar proxy
+// generation on its behalf.
+type NodeService struct {
+	Kind              ServiceKind
+	ID                string
+	Service           string
+	Tags              []string          `json:",omitempty"`
+	Address           string            `json:",omitempty"`
+	Meta              map[string]string `json:",omitempty"`
+	Port              int
+	EnableTagOverride bool               `json:",omitempty"`
+	Connect           *ServiceConnect    `json:",omitempty"`
+	Proxy             ConnectProxyConfig `json:",omitempty"`
+}
+
+// Validate returns an error if ns has any field set to a value the agent
+// won't accept at registration time.
+func (ns *NodeService) Validate() error {
+	for k := range ns.Meta {
+		if strings.HasPrefix(k, metaKeyReservedPrefix) {
+			return fmt.Errorf("Metadata keys that start with %q are reserved for internal use", metaKeyReservedPrefix)
+		}
+	}
+	return nil
+}
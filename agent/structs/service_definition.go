@@ -0,0 +1,65 @@
+package structs
+
+// ServiceDefinition is the JSON/HCL representation of a service
+// registration, as accepted by the catalog register endpoint and by
+// service definition files/snippets.
+type ServiceDefinition struct {
+	Kind              ServiceKind `json:",omitempty"`
+	ID                string      `json:",omitempty"`
+	Name              string
+	Tags              []string            `json:",omitempty"`
+	Address           string              `json:",omitempty"`
+	Meta              map[string]string   `json:",omitempty"`
+	Port              int                 `json:",omitempty"`
+	Check             CheckType           `json:",omitempty"`
+	Checks            CheckTypes          `json:",omitempty"`
+	Token             string              `json:",omitempty"`
+	EnableTagOverride bool                `json:",omitempty"`
+	Proxy             *ConnectProxyConfig `json:",omitempty"`
+	Connect           *ServiceConnect     `json:",omitempty"`
+
+	// DisableDefaultTCPCheck suppresses the 127.0.0.1:<port> TCP check the
+	// agent would otherwise synthesize for an auto-generated sidecar proxy,
+	// e.g. because it's bound to a Unix socket or a non-loopback address
+	// instead.
+	DisableDefaultTCPCheck bool `json:"disable_default_tcp_check,omitempty"`
+}
+
+// NodeService converts the service definition into the NodeService the
+// agent registers in its local state.
+func (s *ServiceDefinition) NodeService() *NodeService {
+	ns := &NodeService{
+		Kind:              s.Kind,
+		ID:                s.ID,
+		Service:           s.Name,
+		Tags:              s.Tags,
+		Address:           s.Address,
+		Meta:              s.Meta,
+		Port:              s.Port,
+		EnableTagOverride: s.EnableTagOverride,
+		Connect:           s.Connect,
+	}
+	if s.Proxy != nil {
+		ns.Proxy = *s.Proxy
+		ns.Proxy.Upstreams = addUpstreamDefaults(ns.Proxy.Upstreams)
+	}
+	return ns
+}
+
+// CheckTypes returns every check (the singular Check plus Checks) this
+// definition wants registered, validating each in turn.
+func (s *ServiceDefinition) CheckTypes() (CheckTypes, error) {
+	var out CheckTypes
+	if !s.Check.Empty() {
+		c := s.Check
+		out = append(out, &c)
+	}
+	out = append(out, s.Checks...)
+
+	for _, c := range out {
+		if err := c.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,30 @@
+package structs
+
+import "testing"
+
+// TestUpstreams returns a sample Upstreams list for use in tests that need
+// a non-trivial Connect proxy upstream configuration.
+func TestUpstreams(t *testing.T) Upstreams {
+	t.Helper()
+	return Upstreams{
+		{
+			DestinationType: UpstreamDestTypeService,
+			DestinationName: "db",
+			LocalBindPort:   1234,
+		},
+		{
+			DestinationType: UpstreamDestTypePreparedQuery,
+			DestinationName: "geo-cache",
+			Datacenter:      "dc2",
+			LocalBindPort:   1235,
+		},
+	}
+}
+
+// TestAddDefaultsToUpstreams applies the same defaulting a registered
+// ConnectProxyConfig gets, so tests can assert against it without
+// duplicating the defaulting logic.
+func TestAddDefaultsToUpstreams(t *testing.T, us Upstreams) Upstreams {
+	t.Helper()
+	return addUpstreamDefaults(us)
+}
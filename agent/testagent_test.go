@@ -0,0 +1,21 @@
+package agent
+
+import "github.com/hashicorp/consul/agent/config"
+
+// NewTestAgent builds an Agent for use in tests: it decodes hclConfig (HCL
+// or JSON) into a RuntimeConfig, applies nodeName and the "dc1" default
+// datacenter tests rely on, and constructs the Agent from it.
+func NewTestAgent(nodeName, hclConfig string) *Agent {
+	c, err := config.Parse(hclConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	rt := config.Build(c)
+	rt.NodeName = nodeName
+	if rt.Datacenter == "" {
+		rt.Datacenter = "dc1"
+	}
+
+	return NewAgent(rt)
+}